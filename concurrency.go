@@ -0,0 +1,168 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var queueDepth = prometheus.NewGauge(
+	prometheus.GaugeOpts{Name: "status_check_queue_depth"},
+)
+
+func init() {
+	prometheus.MustRegister(queueDepth)
+}
+
+// checkPhaseOffset deterministically spreads checks sharing an interval
+// across the tick window, so a config with dozens of checks on the same
+// interval doesn't fire them all at the same wall-clock boundary.
+func checkPhaseOffset(check string, interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(check))
+
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// sleepPhase blocks for offset (as computed by checkPhaseOffset), returning
+// early (and reporting false) if ctx is cancelled first.
+func sleepPhase(ctx context.Context, offset time.Duration) bool {
+	if offset <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(offset)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// semWaiter is one check blocked waiting for a concurrency slot.
+type semWaiter struct {
+	priority int
+	seq      int // breaks priority ties in FIFO order
+	grant    chan struct{}
+}
+
+// waiterHeap is a max-heap on priority (and, within a priority, FIFO order).
+type waiterHeap []*semWaiter
+
+func (h waiterHeap) Len() int { return len(h) }
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h waiterHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *waiterHeap) Push(x any)   { *h = append(*h, x.(*semWaiter)) }
+func (h *waiterHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// prioritySemaphore caps concurrent check runs at capacity. When the
+// semaphore is saturated, a freed slot goes to the highest-priority waiter
+// rather than strictly FIFO, so a handful of critical probes configured
+// with a high Check.Priority keep running promptly even when lower-priority
+// checks are queued ahead of them.
+type prioritySemaphore struct {
+	mu       sync.Mutex
+	capacity int
+	inUse    int
+	waiters  waiterHeap
+	nextSeq  int
+}
+
+func newPrioritySemaphore(capacity int) *prioritySemaphore {
+	return &prioritySemaphore{capacity: capacity}
+}
+
+// Acquire blocks until a slot is free or ctx is cancelled. A non-positive
+// capacity disables limiting entirely.
+func (s *prioritySemaphore) Acquire(ctx context.Context, priority int) error {
+	if s.capacity <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	if s.inUse < s.capacity {
+		s.inUse++
+		s.mu.Unlock()
+		return nil
+	}
+
+	w := &semWaiter{priority: priority, seq: s.nextSeq, grant: make(chan struct{}, 1)}
+	s.nextSeq++
+	heap.Push(&s.waiters, w)
+	queueDepth.Set(float64(len(s.waiters)))
+	s.mu.Unlock()
+
+	select {
+	case <-w.grant:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		removed := s.removeWaiter(w)
+		queueDepth.Set(float64(len(s.waiters)))
+		s.mu.Unlock()
+
+		if !removed {
+			// Release() already popped w and handed it the slot, racing
+			// with our cancellation; drain the grant and hand the slot
+			// back so it isn't leaked.
+			<-w.grant
+			s.Release()
+		}
+
+		return ctx.Err()
+	}
+}
+
+// Release frees the caller's slot, handing it directly to the
+// highest-priority waiter if any are queued.
+func (s *prioritySemaphore) Release() {
+	if s.capacity <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.waiters) == 0 {
+		s.inUse--
+		return
+	}
+
+	w := heap.Pop(&s.waiters).(*semWaiter)
+	queueDepth.Set(float64(len(s.waiters)))
+	w.grant <- struct{}{}
+}
+
+// removeWaiter removes target from the heap if it's still queued, reporting
+// whether it found (and removed) it.
+func (s *prioritySemaphore) removeWaiter(target *semWaiter) bool {
+	for i, w := range s.waiters {
+		if w == target {
+			heap.Remove(&s.waiters, i)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPrioritySemaphoreUnlimitedWhenCapacityNonPositive(t *testing.T) {
+	s := newPrioritySemaphore(0)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if err := s.Acquire(ctx, 0); err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+	}
+	// Release on an unlimited semaphore is a no-op, not a panic.
+	s.Release()
+}
+
+func TestPrioritySemaphoreGrantsHighestPriorityFirst(t *testing.T) {
+	s := newPrioritySemaphore(1)
+	ctx := context.Background()
+
+	if err := s.Acquire(ctx, 0); err != nil {
+		t.Fatalf("Acquire (slot holder): %v", err)
+	}
+
+	done := make(chan int, 2)
+	wait := func(priority int) {
+		if err := s.Acquire(ctx, priority); err != nil {
+			return
+		}
+		done <- priority
+	}
+
+	// Queue the low-priority waiter first so FIFO order alone would grant it
+	// the slot before the high-priority waiter queued after it.
+	go wait(1)
+	time.Sleep(20 * time.Millisecond)
+	go wait(10)
+	time.Sleep(20 * time.Millisecond)
+
+	s.Release() // frees the original holder's slot to a queued waiter
+
+	select {
+	case got := <-done:
+		if got != 10 {
+			t.Fatalf("first granted waiter had priority %d, want 10 (higher priority should jump the FIFO queue)", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a waiter to be granted the slot")
+	}
+
+	s.Release()
+	select {
+	case got := <-done:
+		if got != 1 {
+			t.Fatalf("second granted waiter had priority %d, want 1", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the remaining waiter to be granted the slot")
+	}
+}
+
+func TestPrioritySemaphoreAcquireCancelledDoesNotLeakSlot(t *testing.T) {
+	s := newPrioritySemaphore(1)
+	ctx := context.Background()
+
+	if err := s.Acquire(ctx, 0); err != nil {
+		t.Fatalf("Acquire (slot holder): %v", err)
+	}
+
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Acquire(cancelCtx, 0) }()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("Acquire on a cancelled ctx returned nil error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for cancelled Acquire to return")
+	}
+
+	s.Release() // the original holder's release
+
+	// The slot must now be free again, not leaked by the cancelled waiter.
+	acquired := make(chan struct{})
+	go func() {
+		if err := s.Acquire(context.Background(), 0); err == nil {
+			close(acquired)
+		}
+	}()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("slot appears leaked: a fresh Acquire never succeeded")
+	}
+}
+
+func TestCheckPhaseOffsetIsDeterministicAndInRange(t *testing.T) {
+	interval := 10 * time.Second
+
+	a := checkPhaseOffset("same-check", interval)
+	b := checkPhaseOffset("same-check", interval)
+	if a != b {
+		t.Fatalf("checkPhaseOffset is not deterministic: %s != %s", a, b)
+	}
+	if a < 0 || a >= interval {
+		t.Fatalf("checkPhaseOffset = %s, want in [0, %s)", a, interval)
+	}
+
+	if got := checkPhaseOffset("any-check", 0); got != 0 {
+		t.Fatalf("checkPhaseOffset with zero interval = %s, want 0", got)
+	}
+}
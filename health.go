@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// healthRegistry tracks the last known up/down state of every check so the
+// /healthz and /ready HTTP endpoints can report overall checker health for
+// Kubernetes liveness/readiness probes.
+type healthRegistry struct {
+	mu     sync.RWMutex
+	status map[string]bool
+}
+
+func newHealthRegistry() *healthRegistry {
+	return &healthRegistry{status: map[string]bool{}}
+}
+
+func (h *healthRegistry) set(check string, up bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status[check] = up
+}
+
+// ready reports whether every known check is currently up, along with the
+// names of any that aren't.
+func (h *healthRegistry) ready() (bool, []string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var down []string
+	for check, up := range h.status {
+		if !up {
+			down = append(down, check)
+		}
+	}
+
+	return len(down) == 0, down
+}
+
+// registerHealthHandlers wires /healthz (liveness: the process is up and
+// serving) and /ready (readiness: every check is currently up) onto mux.
+func registerHealthHandlers(mux *http.ServeMux, registry *healthRegistry) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		ready, down := registry.ready()
+		if ready {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, "ok")
+			return
+		}
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "down: %s\n", strings.Join(down, ", "))
+	})
+}
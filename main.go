@@ -2,15 +2,17 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/antithesishq/antithesis-sdk-go/assert"
@@ -25,32 +27,158 @@ import (
 
 var metric = prometheus.NewCounterVec(
 	prometheus.CounterOpts{Name: "status_check"},
-	[]string{"check", "success"},
+	[]string{"check", "success", "timeout"},
+)
+
+// checkDuration is built by setupMetrics once the configured bucket
+// boundaries are known, rather than at package init time.
+var checkDuration *prometheus.HistogramVec
+
+var checkState = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{Name: "status_check_state"},
+	[]string{"check"},
+)
+
+var lastSuccessTimestamp = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{Name: "status_check_last_success_timestamp_seconds"},
+	[]string{"check"},
+)
+
+var lastDuration = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{Name: "status_check_last_duration_seconds"},
+	[]string{"check"},
+)
+
+var inflight = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{Name: "status_check_inflight"},
+	[]string{"check"},
+)
+
+var consecutiveFailures = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{Name: "status_check_consecutive_failures"},
+	[]string{"check"},
 )
 
 func init() {
 	prometheus.MustRegister(metric)
+	prometheus.MustRegister(checkState)
+	prometheus.MustRegister(lastSuccessTimestamp)
+	prometheus.MustRegister(lastDuration)
+	prometheus.MustRegister(inflight)
+	prometheus.MustRegister(consecutiveFailures)
 }
 
+// MetricsConfig controls the buckets used by the status_check_duration_seconds
+// histogram.
+type MetricsConfig struct {
+	// Buckets overrides Prometheus's default bucket boundaries (in seconds).
+	// Unset keeps prometheus.DefBuckets.
+	Buckets []float64 `mapstructure:"buckets"`
+}
+
+// setupMetrics builds and registers checkDuration with cfg's bucket
+// boundaries. It must run exactly once, before any check starts recording
+// durations.
+func setupMetrics(cfg MetricsConfig) {
+	buckets := cfg.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	checkDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: "status_check_duration_seconds", Buckets: buckets},
+		[]string{"check", "success"},
+	)
+	prometheus.MustRegister(checkDuration)
+}
+
+// logSchemaVersion is bumped whenever the shape of the structured log events
+// emitted for a check run changes in a backwards-incompatible way, so
+// downstream parsers (Elasticsearch/Loki ingest pipelines) can detect drift.
+const logSchemaVersion = 1
+
+// Supported values for Logs.Format.
+const (
+	LogFormatConsole = "console"
+	LogFormatPretty  = "pretty"
+	LogFormatJSON    = "json"
+	LogFormatECS     = "ecs"
+)
+
 type Check struct {
 	Enabled  *bool          `mapstructure:"enabled"`
 	Interval *time.Duration `mapstructure:"interval"`
+
+	// HTTP, TCP, GRPC and Exec select a CheckSource other than the default
+	// filesystem script. At most one may be set per check.
+	HTTP *HTTPCheckConfig `mapstructure:"http"`
+	TCP  *TCPCheckConfig  `mapstructure:"tcp"`
+	GRPC *GRPCCheckConfig `mapstructure:"grpc"`
+	Exec *ExecCheckConfig `mapstructure:"exec"`
+
+	// Timeout overrides the global default for how long a single run of
+	// this check may take before it's killed and recorded as a timeout.
+	Timeout *time.Duration `mapstructure:"timeout"`
+
+	// Retry controls within-tick retries and flapping suppression. Nil
+	// means a single attempt with no suppression (the historical behaviour).
+	Retry *RetryConfig `mapstructure:"retry"`
+
+	// Priority determines queueing order once max_concurrent is saturated;
+	// higher runs sooner. Defaults to 0.
+	Priority *int `mapstructure:"priority"`
+}
+
+// HTTPCheckConfig probes an HTTP(S) endpoint.
+type HTTPCheckConfig struct {
+	URL            string `mapstructure:"url" validate:"required,url"`
+	Method         string `mapstructure:"method"`
+	Body           string `mapstructure:"body"`
+	ExpectedStatus int    `mapstructure:"expected_status"`
+	BodyRegex      string `mapstructure:"body_regex"`
+}
+
+// TCPCheckConfig dials a TCP endpoint, optionally over TLS.
+type TCPCheckConfig struct {
+	Address             string        `mapstructure:"address" validate:"required"`
+	TLS                 bool          `mapstructure:"tls"`
+	CertExpiryThreshold time.Duration `mapstructure:"cert_expiry_threshold"`
+}
+
+// GRPCCheckConfig calls the standard gRPC health checking protocol.
+type GRPCCheckConfig struct {
+	Address string `mapstructure:"address" validate:"required"`
+	Service string `mapstructure:"service"`
+}
+
+// ExecCheckConfig runs a command inside a running container via
+// `docker exec`.
+type ExecCheckConfig struct {
+	Container string   `mapstructure:"container" validate:"required"`
+	Command   []string `mapstructure:"command" validate:"required,min=1"`
 }
 
 type Logs struct {
+	// Pretty is kept for backwards compatibility with existing configs;
+	// setting it is equivalent to format: pretty.
 	Pretty bool   `mapstructure:"pretty"`
 	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format" validate:"omitempty,oneof=console pretty json ecs"`
 }
 
 type Config struct {
 	EnabledByDefault  bool             `mapstructure:"enabled_by_default"`
 	Interval          time.Duration    `mapstructure:"interval" validate:"required"`
+	Timeout           time.Duration    `mapstructure:"timeout" validate:"required"`
 	Logs              Logs             `mapstructure:"logs"`
 	ChecksDir         string           `mapstructure:"checks_dir" validate:"required,dir"`
-	Checks            map[string]Check `mapstructure:"checks"`
+	Checks            map[string]Check `mapstructure:"checks" validate:"dive"`
 	ModifyPermissions bool             `mapstructure:"modify_permissions"`
 	PromPort          uint             `mapstructure:"prom_port" validate:"required"`
 	Antithesis        bool             `mapstructure:"antithesis"`
+	Notifiers         []NotifierConfig `mapstructure:"notifiers" validate:"dive"`
+	MaxConcurrent     int              `mapstructure:"max_concurrent"`
+	Metrics           MetricsConfig    `mapstructure:"metrics"`
 }
 
 // expandEnvHookFunc expands environment variables when the viper is decoding
@@ -64,9 +192,13 @@ func expandEnvHookFunc() mapstructure.DecodeHookFunc {
 	}
 }
 
-func blockFor(duration time.Duration, path string) {
+// blockFor waits until the next tick boundary, or returns early (reporting
+// false) if ctx is cancelled first so a shutdown doesn't have to wait out a
+// full interval. phase shifts the boundary so checks sharing an interval
+// don't all fire at the same wall-clock instant.
+func blockFor(ctx context.Context, duration, phase time.Duration, path string) bool {
 	now := time.Now()
-	target := now.Add(duration / 2).Round(duration)
+	target := now.Add(duration / 2).Round(duration).Add(phase)
 
 	log.Trace().
 		Time("now", now).
@@ -76,7 +208,13 @@ func blockFor(duration time.Duration, path string) {
 
 	timer := time.NewTimer(time.Until(target))
 	defer timer.Stop()
-	<-timer.C
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 func loadConfig() (*Config, error) {
@@ -95,6 +233,7 @@ func loadConfig() (*Config, error) {
 
 	v.SetDefault("enabled_by_default", true)
 	v.SetDefault("interval", "30s")
+	v.SetDefault("timeout", "30s")
 	v.SetDefault("checks_dir", "./checks")
 	v.SetDefault("logs::pretty", false)
 	v.SetDefault("logs::level", "info")
@@ -122,9 +261,55 @@ func loadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	for _, n := range cfg.Notifiers {
+		if err := validateNotifierConfig(n); err != nil {
+			return nil, err
+		}
+	}
+
 	return &cfg, nil
 }
 
+// ecsHook decorates every log event with the handful of Elastic Common
+// Schema fields operators expect when shipping straight into an ECS-aware
+// stack, without having to run a Logstash/Loki pipeline to rename fields.
+type ecsHook struct{}
+
+func (ecsHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	e.Str("event.dataset", "status_checker")
+	e.Str("ecs.version", "8.11.0")
+}
+
+// ecsMode is set by setupLogging when Logs.Format is ecs, so logCheckResult
+// can emit the per-check fields under their ECS field names instead of the
+// generic ones.
+var ecsMode bool
+
+// setupLogging configures the global zerolog logger according to cfg.Format,
+// falling back to the legacy cfg.Pretty flag when Format is unset so existing
+// configs keep working.
+func setupLogging(cfg Logs) {
+	format := cfg.Format
+	if format == "" {
+		format = LogFormatConsole
+		if cfg.Pretty {
+			format = LogFormatPretty
+		}
+	}
+
+	switch format {
+	case LogFormatPretty:
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	case LogFormatConsole:
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: true})
+	case LogFormatJSON:
+		// zerolog's default writer is already line-delimited JSON.
+	case LogFormatECS:
+		ecsMode = true
+		log.Logger = log.Hook(ecsHook{})
+	}
+}
+
 func discoverChecks(dir string, chmod bool) ([]string, error) {
 	var files []string
 
@@ -188,96 +373,200 @@ func discoverChecks(dir string, chmod bool) ([]string, error) {
 	return files, err
 }
 
-func runCheck(path, check string) bool {
-	cmd := exec.Command(path)
-	cmd.Env = os.Environ()
-	logger := log.With().Str("check", check).Logger()
+// checkResult carries everything about a single check run that we want to
+// surface as structured log fields and Prometheus samples.
+type checkResult struct {
+	success     bool
+	timeout     bool
+	duration    time.Duration
+	exitCode    int
+	stdoutBytes int
+	stderrBytes int
+	attempt     int
+}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to get pipe")
-		return false
+// streamLines reads lines from r and logs each one as its own structured
+// event tagged with the originating stream, returning the summed length of
+// the logged lines after surrounding whitespace is trimmed (line terminators
+// are not counted).
+func streamLines(r *bufio.Scanner, logger zerolog.Logger, stream string) int {
+	bytes := 0
+	for r.Scan() {
+		line := strings.TrimSpace(r.Text())
+		bytes += len(line)
+		logger.Debug().
+			Int("schema_version", logSchemaVersion).
+			Str("stream", stream).
+			Msg(line)
 	}
-	cmd.Stderr = cmd.Stdout
+	return bytes
+}
 
-	if err := cmd.Start(); err != nil {
-		logger.Error().Err(err).Msg("Failed to start command")
-		return false
-	}
+func runCheckLoop(ctx context.Context, source CheckSource, check string, interval, timeout time.Duration, retry RetryConfig, priority int, antithesis bool, notifiers *NotifierManager, health *healthRegistry, sem *prioritySemaphore, wg *sync.WaitGroup) {
+	defer wg.Done()
+	state := flapState{up: true}
+	phase := checkPhaseOffset(check, interval)
 
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		logger.Debug().Msg(line)
+	// Stagger the very first run too, not just the inter-tick wait below,
+	// so a process start (or a SIGHUP reload relaunching every check) doesn't
+	// fire every check at once.
+	if !sleepPhase(ctx, phase) {
+		return
 	}
 
-	if err := scanner.Err(); err != nil {
-		logger.Warn().Err(err).Msg("Failed to read output")
-	}
+	for {
+		if ctx.Err() != nil {
+			return
+		}
 
-	if err := cmd.Wait(); err != nil {
-		logger.Error().Err(err).Send()
-		return false
-	}
+		if err := sem.Acquire(ctx, priority); err != nil {
+			return
+		}
 
-	return true
-}
+		inflight.WithLabelValues(check).Inc()
+		result := attemptWithRetry(ctx, source, check, retry, timeout)
+		inflight.WithLabelValues(check).Dec()
+		sem.Release()
 
-func runCheckLoop(path, check string, interval time.Duration, antithesis bool, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for {
-		ok := runCheck(path, check)
+		if ctx.Err() != nil {
+			// The run was cut short by shutdown/reload cancelling ctx, not a
+			// real probe failure; don't record a down-transition or fire a
+			// notification for it.
+			return
+		}
+
+		up, transitioned := state.observe(result.success, retry)
+		checkState.WithLabelValues(check).Set(boolToFloat(up))
+		lastDuration.WithLabelValues(check).Set(result.duration.Seconds())
+		consecutiveFailures.WithLabelValues(check).Set(float64(state.consecutiveFailures))
+		if result.success {
+			lastSuccessTimestamp.WithLabelValues(check).SetToCurrentTime()
+		}
+		health.set(check, up)
+
+		notifiers.Dispatch(NotifyEvent{
+			Check:        check,
+			Up:           up,
+			Transitioned: transitioned,
+			Result:       result,
+			Time:         time.Now(),
+		})
 
-		log.Info().Str("check", check).Bool("success", ok).Send()
-		metric.WithLabelValues(check, strconv.FormatBool(ok)).Inc()
+		logCheckResult(check, result, up)
+		metric.WithLabelValues(check, strconv.FormatBool(result.success), strconv.FormatBool(result.timeout)).Inc()
+		checkDuration.WithLabelValues(check, strconv.FormatBool(result.success)).Observe(result.duration.Seconds())
 
 		if antithesis {
-			details := map[string]any{"check": check, "success": ok}
-			assert.Always(ok, "check run succeeded", details)
+			details := map[string]any{"check": check, "success": result.success, "up": up}
+			assert.Always(up, "check state stayed up", details)
 		}
 
-		blockFor(interval, check)
+		if !blockFor(ctx, interval, phase, check) {
+			return
+		}
 	}
 }
 
-func main() {
-	cfg, err := loadConfig()
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to load config")
+// logCheckResult emits the structured per-check log event. In ecsMode the
+// check-specific fields are named after their Elastic Common Schema
+// equivalents (e.g. exit_code becomes process.exit_code) so the event drops
+// straight into an ECS-aware index without a rename pipeline; otherwise the
+// original generic field names are used.
+func logCheckResult(check string, result checkResult, up bool) {
+	evt := log.Info().
+		Bool("success", result.success).
+		Bool("up", up).
+		Bool("timeout", result.timeout).
+		Int("attempt", result.attempt).
+		Int("schema_version", logSchemaVersion)
+
+	if ecsMode {
+		evt = evt.
+			Str("labels.check", check).
+			Dur("event.duration", result.duration).
+			Int("process.exit_code", result.exitCode).
+			Int("process.stdout_bytes", result.stdoutBytes).
+			Int("process.stderr_bytes", result.stderrBytes)
+	} else {
+		evt = evt.
+			Str("check", check).
+			Dur("duration_ms", result.duration).
+			Int("exit_code", result.exitCode).
+			Int("stdout_bytes", result.stdoutBytes).
+			Int("stderr_bytes", result.stderrBytes)
 	}
 
-	level, err := zerolog.ParseLevel(cfg.Logs.Level)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to parse log level")
-	}
-	zerolog.SetGlobalLevel(level)
+	evt.Send()
+}
 
-	if cfg.Logs.Pretty {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
 	}
+	return 0
+}
 
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		log.Info().Msg("Starting Prometheus")
-
-		if err := http.ListenAndServe(fmt.Sprint(":", cfg.PromPort), nil); err != nil {
-			log.Error().Err(err).Msg("Failed to start Prometheus")
-		}
-	}()
-
+// startChecks discovers and launches all enabled checks, returning the
+// WaitGroup that settles once ctx is cancelled and every runCheckLoop has
+// unwound.
+func startChecks(ctx context.Context, cfg *Config, health *healthRegistry) (*sync.WaitGroup, error) {
 	checks, err := discoverChecks(cfg.ChecksDir, cfg.ModifyPermissions)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to discover checks")
+		return nil, fmt.Errorf("discover checks: %w", err)
 	}
 
-	if len(checks) == 0 {
+	notifiers, err := newNotifierManager(cfg.Notifiers)
+	if err != nil {
+		return nil, fmt.Errorf("configure notifiers: %w", err)
+	}
+
+	sem := newPrioritySemaphore(cfg.MaxConcurrent)
+
+	if len(checks) == 0 && len(cfg.Checks) == 0 {
 		log.Warn().Str("checks_dir", cfg.ChecksDir).Msg("No checks found")
-		return
+		return &sync.WaitGroup{}, nil
 	}
 
 	log.Info().Msg("Starting status-checker")
 
 	var wg sync.WaitGroup
+	started := map[string]bool{}
+
+	startCheck := func(name string, check Check, path string) {
+		if check.Enabled == nil {
+			check.Enabled = &cfg.EnabledByDefault
+		}
+		if check.Interval == nil {
+			check.Interval = &cfg.Interval
+		}
+		if check.Timeout == nil {
+			check.Timeout = &cfg.Timeout
+		}
+		retry := defaultRetryConfig()
+		if check.Retry != nil {
+			retry = *check.Retry
+		}
+		priority := 0
+		if check.Priority != nil {
+			priority = *check.Priority
+		}
+
+		if !*check.Enabled {
+			log.Debug().Str("check", name).Msg("Skipping disabled check")
+			return
+		}
+
+		source, err := resolveSource(check, path)
+		if err != nil {
+			log.Error().Err(err).Str("check", name).Msg("Failed to resolve check source")
+			return
+		}
+
+		started[name] = true
+		wg.Add(1)
+		go runCheckLoop(ctx, source, name, *check.Interval, *check.Timeout, retry, priority, cfg.Antithesis, notifiers, health, sem, &wg)
+	}
+
 	for _, path := range checks {
 		name, err := filepath.Rel(cfg.ChecksDir, path)
 		if err != nil {
@@ -293,21 +582,119 @@ func main() {
 			}
 		}
 
-		if check.Enabled == nil {
-			check.Enabled = &cfg.EnabledByDefault
+		startCheck(name, check, path)
+	}
+
+	// Checks backed by a non-script source (HTTP/TCP/gRPC/exec) have no
+	// corresponding file under checks_dir, so they're started from config
+	// alone.
+	for name, check := range cfg.Checks {
+		if started[name] {
+			continue
 		}
-		if check.Interval == nil {
-			check.Interval = &cfg.Interval
+		if check.HTTP == nil && check.TCP == nil && check.GRPC == nil && check.Exec == nil {
+			continue
 		}
 
-		if !*check.Enabled {
-			log.Debug().Str("check", name).Msg("Skipping disabled check")
+		startCheck(name, check, "")
+	}
+
+	return &wg, nil
+}
+
+func main() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load config")
+	}
+
+	level, err := zerolog.ParseLevel(cfg.Logs.Level)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to parse log level")
+	}
+	zerolog.SetGlobalLevel(level)
+	setupLogging(cfg.Logs)
+	setupMetrics(cfg.Metrics)
+
+	health := newHealthRegistry()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	registerHealthHandlers(mux, health)
+
+	promServer := &http.Server{Addr: fmt.Sprint(":", cfg.PromPort), Handler: mux}
+	go func() {
+		log.Info().Msg("Starting Prometheus")
+
+		if err := promServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("Failed to start Prometheus")
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	rootCtx, cancelRoot := context.WithCancel(context.Background())
+
+	// startGeneration launches one generation of check goroutines under a
+	// child of rootCtx, so SIGHUP can tear down just this generation (via the
+	// returned cancel func) without touching rootCtx or the process.
+	startGeneration := func(c *Config) (context.CancelFunc, *sync.WaitGroup, error) {
+		genCtx, cancelGen := context.WithCancel(rootCtx)
+
+		wg, err := startChecks(genCtx, c, health)
+		if err != nil {
+			cancelGen()
+			return nil, nil, err
+		}
+
+		return cancelGen, wg, nil
+	}
+
+	cancelGen, wg, err := startGeneration(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to discover checks")
+	}
+
+	for {
+		sig := <-sigCh
+		log.Info().Str("signal", sig.String()).Msg("Received signal")
+		cancelGen()
+		wg.Wait()
+
+		if sig == syscall.SIGHUP {
+			newCfg, err := loadConfig()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to reload config, keeping previous")
+			} else if newCancelGen, newWg, err := startGeneration(newCfg); err != nil {
+				// A config that parses and validates can still fail to start
+				// (e.g. a notifier sink or check source error at runtime);
+				// don't take the whole process down for it, just restart the
+				// checks with the previous config below.
+				log.Error().Err(err).Msg("Failed to apply reloaded config, keeping previous config running")
+			} else {
+				cfg, cancelGen, wg = newCfg, newCancelGen, newWg
+				log.Info().Msg("Reloaded config")
+				continue
+			}
+
+			cancelGen, wg, err = startGeneration(cfg)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to restart checks with previous config")
+			}
 			continue
 		}
 
-		wg.Add(1)
-		go runCheckLoop(path, name, *check.Interval, cfg.Antithesis, &wg)
+		cancelRoot()
+		break
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := promServer.Shutdown(shutdownCtx); err != nil {
+		log.Warn().Err(err).Msg("Failed to shut down Prometheus server cleanly")
 	}
 
-	wg.Wait()
+	log.Info().Msg("Shutdown complete")
 }
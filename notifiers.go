@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// NotifierConfig declares a single result sink, modelled loosely on
+// CrowdSec's plugin notifiers: a filter selects which checks it applies to,
+// a template renders the payload, and rate-limit/group settings keep a mass
+// outage from spamming the sink.
+type NotifierConfig struct {
+	Name string `mapstructure:"name" validate:"required"`
+
+	// Filter is a single expression of the form `check == "name"` or
+	// `check =~ "regexp"`. Empty matches every check.
+	Filter string `mapstructure:"filter"`
+
+	// Template is a text/template rendered once per flushed batch of
+	// events ([]NotifyEvent). Empty uses a sensible built-in default.
+	Template string `mapstructure:"template"`
+
+	// RateLimit drops events for a given check if one was already sent for
+	// it within this window.
+	RateLimit time.Duration `mapstructure:"rate_limit"`
+
+	// GroupWait batches events arriving within this window into a single
+	// notification instead of sending one per check.
+	GroupWait time.Duration `mapstructure:"group_wait"`
+
+	// Reminder, when set, re-sends a notification for a check that's still
+	// down every time this much time passes, even without a new transition.
+	Reminder time.Duration `mapstructure:"reminder"`
+
+	// Exactly one of the following selects the sink.
+	Webhook *WebhookNotifierConfig `mapstructure:"webhook"`
+	Slack   *SlackNotifierConfig   `mapstructure:"slack"`
+	Email   *EmailNotifierConfig   `mapstructure:"email"`
+	File    *FileNotifierConfig    `mapstructure:"file"`
+}
+
+type WebhookNotifierConfig struct {
+	URL string `mapstructure:"url" validate:"required,url"`
+}
+
+type SlackNotifierConfig struct {
+	WebhookURL string `mapstructure:"webhook_url" validate:"required,url"`
+}
+
+type EmailNotifierConfig struct {
+	SMTPAddr string   `mapstructure:"smtp_addr" validate:"required"`
+	From     string   `mapstructure:"from" validate:"required,email"`
+	To       []string `mapstructure:"to" validate:"required,min=1"`
+}
+
+type FileNotifierConfig struct {
+	Path string `mapstructure:"path" validate:"required"`
+}
+
+// NotifyEvent describes one check's up/down transition, or a periodic
+// reminder while it remains down.
+type NotifyEvent struct {
+	Check        string
+	Up           bool
+	Transitioned bool
+	Result       checkResult
+	Time         time.Time
+}
+
+const defaultNotifyTemplate = `{{range .}}[{{if .Up}}RECOVERED{{else}}DOWN{{end}}] {{.Check}} at {{.Time.Format "2006-01-02T15:04:05Z07:00"}}
+{{end}}`
+
+// sink delivers an already-rendered notification body somewhere.
+type sink interface {
+	Send(body string) error
+}
+
+// notifierInstance is a configured NotifierConfig wired up to its sink,
+// filter and template, tracking enough per-check state to rate-limit and
+// group notifications.
+type notifierInstance struct {
+	cfg    NotifierConfig
+	filter filterFunc
+	sink   sink
+	tmpl   *template.Template
+
+	mu              sync.Mutex
+	lastSentByCheck map[string]time.Time
+	pending         []NotifyEvent
+	flushTimer      *time.Timer
+}
+
+func newNotifierInstance(cfg NotifierConfig) (*notifierInstance, error) {
+	filter, err := compileFilter(cfg.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("notifier %q: %w", cfg.Name, err)
+	}
+
+	s, err := buildSink(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("notifier %q: %w", cfg.Name, err)
+	}
+
+	text := cfg.Template
+	if text == "" {
+		text = defaultNotifyTemplate
+	}
+	tmpl, err := template.New(cfg.Name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("notifier %q: invalid template: %w", cfg.Name, err)
+	}
+
+	return &notifierInstance{
+		cfg:             cfg,
+		filter:          filter,
+		sink:            s,
+		tmpl:            tmpl,
+		lastSentByCheck: map[string]time.Time{},
+	}, nil
+}
+
+// handle decides whether event is worth sending (it's a transition, or a
+// due reminder while down) and, if so, queues it for delivery.
+func (n *notifierInstance) handle(event NotifyEvent) {
+	if !n.filter(event) {
+		return
+	}
+
+	n.mu.Lock()
+
+	isReminder := !event.Transitioned && !event.Up
+	if isReminder && n.cfg.Reminder <= 0 {
+		n.mu.Unlock()
+		return
+	}
+	if !event.Transitioned && !isReminder {
+		n.mu.Unlock()
+		return
+	}
+
+	last, seen := n.lastSentByCheck[event.Check]
+	if seen {
+		minGap := n.cfg.RateLimit
+		if isReminder && n.cfg.Reminder > minGap {
+			minGap = n.cfg.Reminder
+		}
+		if minGap > 0 && time.Since(last) < minGap {
+			n.mu.Unlock()
+			return
+		}
+	}
+
+	n.lastSentByCheck[event.Check] = event.Time
+	n.pending = append(n.pending, event)
+
+	if n.cfg.GroupWait <= 0 {
+		batch := n.pending
+		n.pending = nil
+		n.mu.Unlock()
+		n.send(batch)
+		return
+	}
+
+	if n.flushTimer == nil {
+		n.flushTimer = time.AfterFunc(n.cfg.GroupWait, n.flush)
+	}
+	n.mu.Unlock()
+}
+
+func (n *notifierInstance) flush() {
+	n.mu.Lock()
+	batch := n.pending
+	n.pending = nil
+	n.flushTimer = nil
+	n.mu.Unlock()
+
+	if len(batch) > 0 {
+		n.send(batch)
+	}
+}
+
+func (n *notifierInstance) send(batch []NotifyEvent) {
+	var body bytes.Buffer
+	if err := n.tmpl.Execute(&body, batch); err != nil {
+		log.Error().Err(err).Str("notifier", n.cfg.Name).Msg("Failed to render notification template")
+		return
+	}
+
+	if err := n.sink.Send(body.String()); err != nil {
+		log.Error().Err(err).Str("notifier", n.cfg.Name).Msg("Failed to deliver notification")
+	}
+}
+
+// buildSink picks the sink implementation for cfg, requiring exactly one of
+// Webhook/Slack/Email/File to be set.
+func buildSink(cfg NotifierConfig) (sink, error) {
+	set := 0
+	var s sink
+
+	if cfg.Webhook != nil {
+		set++
+		s = webhookSink{url: cfg.Webhook.URL}
+	}
+	if cfg.Slack != nil {
+		set++
+		s = slackSink{webhookURL: cfg.Slack.WebhookURL}
+	}
+	if cfg.Email != nil {
+		set++
+		s = emailSink{cfg: *cfg.Email}
+	}
+	if cfg.File != nil {
+		set++
+		s = fileSink{path: cfg.File.Path}
+	}
+
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of webhook/slack/email/file must be set")
+	}
+
+	return s, nil
+}
+
+type webhookSink struct {
+	url string
+}
+
+func (w webhookSink) Send(body string) error {
+	resp, err := http.Post(w.url, "application/json", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type slackSink struct {
+	webhookURL string
+}
+
+func (s slackSink) Send(body string) error {
+	payload, err := json.Marshal(map[string]string{"text": body})
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(s.webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type emailSink struct {
+	cfg EmailNotifierConfig
+}
+
+func (e emailSink) Send(body string) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: status-checker notification\r\n\r\n%s",
+		e.cfg.From, strings.Join(e.cfg.To, ", "), body)
+
+	return smtp.SendMail(e.cfg.SMTPAddr, nil, e.cfg.From, e.cfg.To, []byte(msg))
+}
+
+type fileSink struct {
+	path string
+}
+
+func (f fileSink) Send(body string) error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(body)
+	return err
+}
+
+// filterFunc reports whether a notifier should consider event.
+type filterFunc func(NotifyEvent) bool
+
+// compileFilter parses a single `check == "name"` or `check =~ "regexp"`
+// expression. An empty expression matches everything.
+func compileFilter(expr string) (filterFunc, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return func(NotifyEvent) bool { return true }, nil
+	}
+
+	for _, op := range []string{"=~", "=="} {
+		idx := strings.Index(expr, op)
+		if idx == -1 {
+			continue
+		}
+
+		field := strings.TrimSpace(expr[:idx])
+		if field != "check" {
+			return nil, fmt.Errorf("unsupported filter field %q", field)
+		}
+
+		value := strings.Trim(strings.TrimSpace(expr[idx+len(op):]), `"`)
+
+		if op == "=~" {
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter regexp %q: %w", value, err)
+			}
+			return func(e NotifyEvent) bool { return re.MatchString(e.Check) }, nil
+		}
+
+		return func(e NotifyEvent) bool { return e.Check == value }, nil
+	}
+
+	return nil, fmt.Errorf("invalid filter expression %q", expr)
+}
+
+// validateNotifierConfig compiles cfg's filter expression and template so a
+// typo is caught by loadConfig's validation pass, rather than only surfacing
+// later when newNotifierManager builds the real notifier inside startChecks.
+func validateNotifierConfig(cfg NotifierConfig) error {
+	if _, err := compileFilter(cfg.Filter); err != nil {
+		return fmt.Errorf("notifier %q: %w", cfg.Name, err)
+	}
+
+	text := cfg.Template
+	if text == "" {
+		text = defaultNotifyTemplate
+	}
+	if _, err := template.New(cfg.Name).Parse(text); err != nil {
+		return fmt.Errorf("notifier %q: invalid template: %w", cfg.Name, err)
+	}
+
+	return nil
+}
+
+// NotifierManager fans a NotifyEvent out to every configured notifier whose
+// filter matches.
+type NotifierManager struct {
+	instances []*notifierInstance
+}
+
+func newNotifierManager(cfgs []NotifierConfig) (*NotifierManager, error) {
+	instances := make([]*notifierInstance, 0, len(cfgs))
+	for _, c := range cfgs {
+		inst, err := newNotifierInstance(c)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, inst)
+	}
+
+	return &NotifierManager{instances: instances}, nil
+}
+
+// Dispatch is safe to call on a nil manager (no notifiers configured).
+func (m *NotifierManager) Dispatch(event NotifyEvent) {
+	if m == nil {
+		return
+	}
+	for _, inst := range m.instances {
+		inst.handle(event)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestCompileFilter(t *testing.T) {
+	cases := []struct {
+		name    string
+		expr    string
+		check   string
+		want    bool
+		wantErr bool
+	}{
+		{"empty matches everything", "", "anything", true, false},
+		{"equality match", `check == "db"`, "db", true, false},
+		{"equality no match", `check == "db"`, "web", false, false},
+		{"regexp match", `check =~ "^db-"`, "db-primary", true, false},
+		{"regexp no match", `check =~ "^db-"`, "web-primary", false, false},
+		{"invalid regexp", `check =~ "("`, "db", false, true},
+		{"unsupported field", `name == "db"`, "db", false, true},
+		{"unparseable expression", "check", "db", false, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := compileFilter(c.expr)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("compileFilter(%q) returned nil error, want one", c.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileFilter(%q) returned error: %v", c.expr, err)
+			}
+			if got := f(NotifyEvent{Check: c.check}); got != c.want {
+				t.Errorf("filter(%q) on check %q = %v, want %v", c.expr, c.check, got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateNotifierConfigCatchesBadFilterAndTemplate(t *testing.T) {
+	base := NotifierConfig{Name: "n", File: &FileNotifierConfig{Path: "/dev/null"}}
+
+	if err := validateNotifierConfig(base); err != nil {
+		t.Fatalf("validateNotifierConfig(valid config) returned error: %v", err)
+	}
+
+	badFilter := base
+	badFilter.Filter = `check =~ "("`
+	if err := validateNotifierConfig(badFilter); err == nil {
+		t.Fatal("validateNotifierConfig(bad filter) returned nil error, want one")
+	}
+
+	badTemplate := base
+	badTemplate.Template = `{{.Check`
+	if err := validateNotifierConfig(badTemplate); err == nil {
+		t.Fatal("validateNotifierConfig(bad template) returned nil error, want one")
+	}
+}
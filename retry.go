@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryConfig controls how a single tick's check run is retried on failure
+// and how many consecutive results it takes to flip the check's reported
+// up/down state, so a lone transient failure doesn't immediately fail an
+// Antithesis assertion or flip status_check_state.
+type RetryConfig struct {
+	MaxAttempts      int           `mapstructure:"max_attempts" validate:"required,min=1,max=20"`
+	Backoff          time.Duration `mapstructure:"backoff" validate:"required"`
+	Jitter           bool          `mapstructure:"jitter"`
+	SuccessThreshold int           `mapstructure:"success_threshold" validate:"required,min=1"`
+	FailureThreshold int           `mapstructure:"failure_threshold" validate:"required,min=1"`
+}
+
+// defaultRetryConfig preserves the pre-retry behaviour: a check either
+// succeeds or fails on its first and only attempt, and every result flips
+// the reported state immediately.
+func defaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:      1,
+		Backoff:          time.Second,
+		SuccessThreshold: 1,
+		FailureThreshold: 1,
+	}
+}
+
+// attemptWithRetry runs source up to retry.MaxAttempts times, waiting an
+// exponential backoff (with full jitter when retry.Jitter is set) between
+// failed attempts, and returns the outcome of the final attempt.
+func attemptWithRetry(ctx context.Context, source CheckSource, check string, retry RetryConfig, timeout time.Duration) checkResult {
+	var result checkResult
+
+	for attempt := 1; attempt <= retry.MaxAttempts; attempt++ {
+		runCtx, cancel := context.WithTimeout(ctx, timeout)
+		result = source.Run(runCtx, check)
+		result.timeout = !result.success && runCtx.Err() == context.DeadlineExceeded
+		result.attempt = attempt
+		cancel()
+
+		if result.success || attempt == retry.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoffDuration(retry.Backoff, attempt, retry.Jitter)):
+		case <-ctx.Done():
+			return result
+		}
+	}
+
+	return result
+}
+
+// maxBackoff caps the doubled backoff so a large max_attempts can't overflow
+// the shift in backoffDuration (or the time.Duration it's stored in).
+const maxBackoff = time.Hour
+
+// backoffDuration returns base doubled once per prior attempt, capped at
+// maxBackoff to avoid overflowing into a negative duration for large
+// attempt counts. With jitter enabled it applies "full jitter" (a uniform
+// random draw between 0 and the computed backoff) to avoid synchronized
+// retry storms across checks.
+func backoffDuration(base time.Duration, attempt int, jitter bool) time.Duration {
+	d := maxBackoff
+	if shift := attempt - 1; shift < 62 {
+		if scaled := base * time.Duration(uint64(1)<<uint(shift)); scaled/time.Duration(uint64(1)<<uint(shift)) == base && scaled < maxBackoff {
+			d = scaled
+		}
+	}
+
+	if jitter {
+		d = time.Duration(rand.Int63n(int64(d) + 1))
+	}
+
+	return d
+}
+
+// flapState tracks consecutive successes/failures for a single check so it
+// only reports an up<->down transition once the relevant threshold is met.
+type flapState struct {
+	up                  bool
+	consecutiveSuccess  int
+	consecutiveFailures int
+}
+
+// observe feeds a tick's result into the state machine and returns the
+// (possibly unchanged) up/down state along with whether it just flipped.
+func (f *flapState) observe(success bool, retry RetryConfig) (up bool, transitioned bool) {
+	before := f.up
+
+	if success {
+		f.consecutiveSuccess++
+		f.consecutiveFailures = 0
+		if !f.up && f.consecutiveSuccess >= retry.SuccessThreshold {
+			f.up = true
+		}
+	} else {
+		f.consecutiveFailures++
+		f.consecutiveSuccess = 0
+		if f.up && f.consecutiveFailures >= retry.FailureThreshold {
+			f.up = false
+		}
+	}
+
+	return f.up, f.up != before
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDuration(t *testing.T) {
+	cases := []struct {
+		name    string
+		base    time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{"first attempt is base", time.Second, 1, time.Second},
+		{"doubles per attempt", time.Second, 3, 4 * time.Second},
+		{"caps at maxBackoff before overflow", time.Second, 35, maxBackoff},
+		{"caps at maxBackoff for huge attempt", time.Second, 1000, maxBackoff},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := backoffDuration(c.base, c.attempt, false)
+			if got != c.want {
+				t.Errorf("backoffDuration(%s, %d, false) = %s, want %s", c.base, c.attempt, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBackoffDurationJitterNeverPanics(t *testing.T) {
+	for _, attempt := range []int{1, 2, 35, 63, 1000} {
+		d := backoffDuration(time.Second, attempt, true)
+		if d < 0 {
+			t.Errorf("backoffDuration(1s, %d, true) = %s, want >= 0", attempt, d)
+		}
+	}
+}
+
+func TestFlapStateObserve(t *testing.T) {
+	retry := RetryConfig{SuccessThreshold: 2, FailureThreshold: 2}
+	f := flapState{up: true}
+
+	up, transitioned := f.observe(false, retry)
+	if up != true || transitioned {
+		t.Fatalf("after 1 failure: up=%v transitioned=%v, want up=true transitioned=false", up, transitioned)
+	}
+
+	up, transitioned = f.observe(false, retry)
+	if up != false || !transitioned {
+		t.Fatalf("after 2 failures: up=%v transitioned=%v, want up=false transitioned=true", up, transitioned)
+	}
+
+	up, transitioned = f.observe(true, retry)
+	if up != false || transitioned {
+		t.Fatalf("after 1 success while down: up=%v transitioned=%v, want up=false transitioned=false", up, transitioned)
+	}
+
+	up, transitioned = f.observe(true, retry)
+	if up != true || !transitioned {
+		t.Fatalf("after 2 successes: up=%v transitioned=%v, want up=true transitioned=true", up, transitioned)
+	}
+}
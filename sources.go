@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CheckSource probes a single target and reports whether it is healthy.
+// Implementations mirror CrowdSec's acquisition modules: the filesystem
+// script source is the original behaviour, and the rest let status-checker
+// be used as a general blackbox prober without wrapping every probe in a
+// shell script.
+type CheckSource interface {
+	// Run executes the probe once and returns its outcome. ctx bounds the
+	// probe's runtime (see the per-check Timeout config) and check is the
+	// logical check name used for logging and metric labels.
+	Run(ctx context.Context, check string) checkResult
+}
+
+// scriptSource runs an executable discovered under checks_dir, exactly as
+// status-checker has always worked.
+type scriptSource struct {
+	path string
+}
+
+func (s scriptSource) Run(ctx context.Context, check string) checkResult {
+	return runScript(ctx, s.path, check)
+}
+
+// runScript execs path (with optional extra args, used by execSource) and
+// streams its combined stdout/stderr as structured log events. The command
+// is killed if ctx is cancelled before it exits.
+func runScript(ctx context.Context, path, check string, args ...string) checkResult {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = os.Environ()
+	logger := log.With().Str("check", check).Logger()
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get pipe")
+		return checkResult{attempt: 1}
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get pipe")
+		return checkResult{attempt: 1}
+	}
+
+	start := time.Now()
+
+	if err := cmd.Start(); err != nil {
+		logger.Error().Err(err).Msg("Failed to start command")
+		return checkResult{attempt: 1}
+	}
+
+	var wg sync.WaitGroup
+	var stdoutBytes, stderrBytes int
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		stdoutBytes = streamLines(bufio.NewScanner(stdout), logger, "stdout")
+	}()
+	go func() {
+		defer wg.Done()
+		stderrBytes = streamLines(bufio.NewScanner(stderr), logger, "stderr")
+	}()
+	wg.Wait()
+
+	err = cmd.Wait()
+	result := checkResult{
+		success:     err == nil,
+		duration:    time.Since(start),
+		exitCode:    cmd.ProcessState.ExitCode(),
+		stdoutBytes: stdoutBytes,
+		stderrBytes: stderrBytes,
+		attempt:     1,
+	}
+
+	if err != nil {
+		logger.Error().Err(err).Send()
+	}
+
+	return result
+}
+
+// httpSource probes an HTTP(S) endpoint and checks the response status code
+// and, optionally, that the body matches a regular expression.
+type httpSource struct {
+	cfg HTTPCheckConfig
+}
+
+func (s httpSource) Run(ctx context.Context, check string) checkResult {
+	logger := log.With().Str("check", check).Logger()
+	method := s.cfg.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, method, s.cfg.URL, bytes.NewReader([]byte(s.cfg.Body)))
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to build HTTP request")
+		return checkResult{attempt: 1, duration: time.Since(start)}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Error().Err(err).Msg("HTTP probe failed")
+		return checkResult{attempt: 1, duration: time.Since(start)}
+	}
+	defer resp.Body.Close()
+
+	var body bytes.Buffer
+	bodyBytes, _ := body.ReadFrom(resp.Body)
+
+	success := true
+	if s.cfg.ExpectedStatus != 0 && resp.StatusCode != s.cfg.ExpectedStatus {
+		success = false
+		logger.Warn().
+			Int("expected_status", s.cfg.ExpectedStatus).
+			Int("status", resp.StatusCode).
+			Msg("Unexpected HTTP status")
+	}
+
+	if success && s.cfg.BodyRegex != "" {
+		matched, err := regexp.MatchString(s.cfg.BodyRegex, body.String())
+		if err != nil {
+			logger.Error().Err(err).Msg("Invalid body_regex")
+			success = false
+		} else if !matched {
+			success = false
+			logger.Warn().Str("body_regex", s.cfg.BodyRegex).Msg("Response body did not match")
+		}
+	}
+
+	return checkResult{
+		success:     success,
+		duration:    time.Since(start),
+		exitCode:    resp.StatusCode,
+		stdoutBytes: int(bodyBytes),
+		attempt:     1,
+	}
+}
+
+// tcpSource dials a TCP (optionally TLS) endpoint and, for TLS, fails the
+// check once the peer certificate is within CertExpiryThreshold of expiring.
+type tcpSource struct {
+	cfg TCPCheckConfig
+}
+
+func (s tcpSource) Run(ctx context.Context, check string) checkResult {
+	logger := log.With().Str("check", check).Logger()
+	start := time.Now()
+
+	dialer := net.Dialer{}
+
+	if !s.cfg.TLS {
+		conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Address)
+		if err != nil {
+			logger.Error().Err(err).Msg("TCP dial failed")
+			return checkResult{attempt: 1, duration: time.Since(start)}
+		}
+		defer conn.Close()
+		return checkResult{success: true, duration: time.Since(start), attempt: 1}
+	}
+
+	tlsDialer := tls.Dialer{NetDialer: &dialer, Config: &tls.Config{}}
+	conn, err := tlsDialer.DialContext(ctx, "tcp", s.cfg.Address)
+	if err != nil {
+		logger.Error().Err(err).Msg("TLS dial failed")
+		return checkResult{attempt: 1, duration: time.Since(start)}
+	}
+	defer conn.Close()
+
+	threshold := s.cfg.CertExpiryThreshold
+	if threshold == 0 {
+		threshold = 14 * 24 * time.Hour
+	}
+
+	for _, cert := range conn.(*tls.Conn).ConnectionState().PeerCertificates {
+		if time.Until(cert.NotAfter) < threshold {
+			logger.Warn().
+				Str("subject", cert.Subject.String()).
+				Time("not_after", cert.NotAfter).
+				Msg("Certificate nearing expiry")
+			return checkResult{duration: time.Since(start), attempt: 1}
+		}
+	}
+
+	return checkResult{success: true, duration: time.Since(start), attempt: 1}
+}
+
+// grpcSource calls the standard gRPC health checking protocol
+// (grpc.health.v1.Health/Check) against Address for Service (empty means the
+// overall server status).
+type grpcSource struct {
+	cfg GRPCCheckConfig
+}
+
+func (s grpcSource) Run(ctx context.Context, check string) checkResult {
+	logger := log.With().Str("check", check).Logger()
+	start := time.Now()
+
+	success, err := grpcHealthCheck(ctx, s.cfg.Address, s.cfg.Service)
+	if err != nil {
+		logger.Error().Err(err).Msg("gRPC health check failed")
+		return checkResult{attempt: 1, duration: time.Since(start)}
+	}
+
+	return checkResult{success: success, duration: time.Since(start), attempt: 1}
+}
+
+// execSource runs a command inside a running container via `docker exec`,
+// reusing the same stdout/stderr streaming as scripts.
+type execSource struct {
+	cfg ExecCheckConfig
+}
+
+func (s execSource) Run(ctx context.Context, check string) checkResult {
+	args := append([]string{"exec", s.cfg.Container}, s.cfg.Command...)
+	return runScript(ctx, "docker", check, args...)
+}
+
+// resolveSource picks the CheckSource for a configured check, defaulting to
+// the filesystem script discovered at path when no other source is set.
+func resolveSource(check Check, path string) (CheckSource, error) {
+	set := 0
+	var source CheckSource
+
+	if check.HTTP != nil {
+		set++
+		source = httpSource{cfg: *check.HTTP}
+	}
+	if check.TCP != nil {
+		set++
+		source = tcpSource{cfg: *check.TCP}
+	}
+	if check.GRPC != nil {
+		set++
+		source = grpcSource{cfg: *check.GRPC}
+	}
+	if check.Exec != nil {
+		set++
+		source = execSource{cfg: *check.Exec}
+	}
+
+	if set > 1 {
+		return nil, fmt.Errorf("check has more than one source configured (http/tcp/grpc/exec are mutually exclusive)")
+	}
+
+	if set == 0 {
+		return scriptSource{path: path}, nil
+	}
+
+	return source, nil
+}